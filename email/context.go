@@ -0,0 +1,18 @@
+package email
+
+import "context"
+
+// SendContext delivers m through e.Transport (or the default cached SMTP
+// transport, built from e.Timeout/TLSConfig/LocalName/CommandTimeout),
+// honoring ctx for dialing and cancellation; per-command deadlines come from
+// the transport's CommandTimeout, not from ctx. Unlike
+// Send, which always uses context.Background(), SendContext lets a caller
+// bound or cancel the send, aborting it even mid-DATA.
+func (e *Email) SendContext(ctx context.Context, m *Message) error {
+	t, err := e.transport()
+	if err != nil {
+		return err
+	}
+	m.extraHeader = e.Header
+	return t.Send(ctx, m)
+}
@@ -0,0 +1,38 @@
+package email
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSendContextRoutesThroughTransport(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+
+	e := New(srv.addr())
+	m := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := e.SendContext(context.Background(), m); err != nil {
+		t.Fatalf("SendContext: %v", err)
+	}
+
+	// A second Send (not SendContext) must reuse the same cached transport
+	// and connection rather than dialing again.
+	if err := e.Send(m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := srv.connections(); got != 1 {
+		t.Fatalf("connections opened = %d, want 1", got)
+	}
+}
+
+func TestSendContextCancelledBeforeDialFails(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+
+	e := New(srv.addr())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := e.SendContext(ctx, m); err == nil {
+		t.Fatal("SendContext with an already-cancelled context should fail")
+	}
+}
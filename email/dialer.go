@@ -0,0 +1,313 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDialTimeout    = 10 * time.Second
+	defaultCommandTimeout = 30 * time.Second
+)
+
+// SendCloser sends messages over an established connection and closes the
+// connection once the caller is done with it. ctx bounds the send: if it's
+// done before the send completes, the connection is closed and the send
+// aborted. Each SMTP command is separately bounded by the Dialer's
+// CommandTimeout; ctx's deadline is not applied to individual commands.
+type SendCloser interface {
+	Send(ctx context.Context, m *Message) error
+	Close() error
+}
+
+// Dialer dials an SMTP server and returns a SendCloser that can send several
+// messages over the same connection, which is considerably faster than
+// opening a new connection for every message.
+type Dialer struct {
+	Host           string
+	Port           int
+	Username       string
+	Password       string
+	Auth           smtp.Auth
+	SSL            bool
+	TLSConfig      *tls.Config
+	Timeout        time.Duration
+	CommandTimeout time.Duration
+	LocalName      string
+}
+
+// NewDialer returns a new Dialer for the given SMTP server, authenticating
+// with plain auth when username is non-empty.
+func NewDialer(host string, port int, username, password string) *Dialer {
+	return &Dialer{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+	}
+}
+
+// Dial opens a connection to the SMTP server and returns a SendCloser ready
+// to send messages over it.
+func (d *Dialer) Dial() (SendCloser, error) {
+	return d.DialContext(context.Background())
+}
+
+// DialContext is like Dial but uses ctx for the initial connection and the
+// SMTP handshake (EHLO/STARTTLS/AUTH).
+func (d *Dialer) DialContext(ctx context.Context) (SendCloser, error) {
+	conn, err := d.netDial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	c, err := smtp.NewClient(conn, d.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sc := &smtpSendCloser{dialer: d, client: c, conn: conn}
+
+	if d.LocalName != "" {
+		if err := sc.refreshDeadline(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		if err := c.Hello(d.LocalName); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if !d.SSL {
+		if err := sc.refreshDeadline(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(d.tlsConfig()); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+	}
+	if auth := d.auth(); auth != nil {
+		if err := sc.refreshDeadline(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := sc.refreshDeadline(); err != nil {
+				c.Close()
+				return nil, err
+			}
+			if err := c.Auth(auth); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+	}
+	return sc, nil
+}
+
+// DialAndSend opens a connection to the SMTP server, sends m, reusing the
+// connection for every message, and closes it once all messages are sent.
+func (d *Dialer) DialAndSend(m ...*Message) error {
+	return d.DialAndSendContext(context.Background(), m...)
+}
+
+// DialAndSendContext is like DialAndSend but threads ctx through the dial
+// and every Send call.
+func (d *Dialer) DialAndSendContext(ctx context.Context, m ...*Message) error {
+	sc, err := d.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	for _, msg := range m {
+		if err := sc.Send(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Dialer) netDial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+	if d.SSL {
+		tlsDialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: d.timeout()}, Config: d.tlsConfig()}
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	return (&net.Dialer{Timeout: d.timeout()}).DialContext(ctx, "tcp", addr)
+}
+
+func (d *Dialer) timeout() time.Duration {
+	if d.Timeout > 0 {
+		return d.Timeout
+	}
+	return defaultDialTimeout
+}
+
+func (d *Dialer) commandTimeout() time.Duration {
+	if d.CommandTimeout > 0 {
+		return d.CommandTimeout
+	}
+	return defaultCommandTimeout
+}
+
+func (d *Dialer) tlsConfig() *tls.Config {
+	if d.TLSConfig != nil {
+		return d.TLSConfig
+	}
+	return &tls.Config{ServerName: d.Host}
+}
+
+func (d *Dialer) auth() smtp.Auth {
+	if d.Auth != nil {
+		return d.Auth
+	}
+	if d.Username == "" {
+		return nil
+	}
+	return smtp.PlainAuth("", d.Username, d.Password, d.Host)
+}
+
+// smtpSendCloser sends messages over a single *smtp.Client connection,
+// redialing once if the connection turns out to be idle or broken, and
+// enforcing a per-command deadline refreshed before every SMTP verb.
+//
+// client and conn are guarded by mu: Send's per-call watcher goroutine
+// closes conn on ctx cancellation concurrently with redial reassigning both
+// fields, so every access goes through the locked getters/setter below.
+type smtpSendCloser struct {
+	dialer *Dialer
+
+	mu     sync.Mutex
+	client *smtp.Client
+	conn   net.Conn
+}
+
+func (s *smtpSendCloser) Send(ctx context.Context, m *Message) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.getConn().Close()
+		case <-done:
+		}
+	}()
+
+	// A deadline that can't be set means the connection is already closed
+	// (e.g. by an earlier cancelled Send), which is handled like a failed RSET.
+	if err := s.refreshDeadline(); err != nil || s.getClient().Reset() != nil {
+		if err := s.redial(ctx); err != nil {
+			return err
+		}
+	}
+	return s.send(m)
+}
+
+func (s *smtpSendCloser) redial(ctx context.Context) error {
+	sc, err := s.dialer.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	next := sc.(*smtpSendCloser)
+
+	old := s.swap(next.client, next.conn)
+	// The old connection is idle or broken; an error closing it doesn't
+	// affect the new one.
+	old.Close()
+	return nil
+}
+
+func (s *smtpSendCloser) send(m *Message) error {
+	m.render()
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	if err := s.refreshDeadline(); err != nil {
+		return err
+	}
+	if err = s.getClient().Mail(from.Address); err != nil {
+		return err
+	}
+	to, err := mail.ParseAddressList(m.To)
+	if err != nil {
+		return err
+	}
+	for _, a := range to {
+		if err := s.refreshDeadline(); err != nil {
+			return err
+		}
+		if err = s.getClient().Rcpt(a.Address); err != nil {
+			return err
+		}
+	}
+	if err := s.refreshDeadline(); err != nil {
+		return err
+	}
+	wc, err := s.getClient().Data()
+	if err != nil {
+		return err
+	}
+	if _, err = m.buffer.WriteTo(wc); err != nil {
+		wc.Close()
+		return err
+	}
+	if err := s.refreshDeadline(); err != nil {
+		return err
+	}
+	return wc.Close()
+}
+
+func (s *smtpSendCloser) refreshDeadline() error {
+	return s.getConn().SetDeadline(time.Now().Add(s.dialer.commandTimeout()))
+}
+
+func (s *smtpSendCloser) getConn() net.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn
+}
+
+func (s *smtpSendCloser) getClient() *smtp.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// swap atomically replaces s's client/conn with the given ones and returns
+// the previous client, so the caller can close it once it's no longer
+// reachable from s.
+func (s *smtpSendCloser) swap(client *smtp.Client, conn net.Conn) *smtp.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.client
+	s.client = client
+	s.conn = conn
+	return old
+}
+
+func (s *smtpSendCloser) Close() error {
+	if err := s.refreshDeadline(); err != nil {
+		return err
+	}
+	return s.getClient().Quit()
+}
@@ -0,0 +1,264 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeSMTPServer speaks just enough SMTP to let net/smtp complete a
+// send, while counting how many TCP connections it accepted and how many
+// messages it received. Setting failNextReset makes the next RSET command
+// on any connection fail once, to exercise smtpSendCloser's redial. Setting
+// resetReached/resetRelease makes RSET block after it's received: the
+// handler signals resetReached then waits on resetRelease before replying,
+// so a test can cancel the client's context while RSET is genuinely
+// in-flight.
+type fakeSMTPServer struct {
+	ln            net.Listener
+	conns         int32
+	messages      int32
+	failNextReset int32
+	resetReached  chan struct{}
+	resetRelease  chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeSMTPServer{ln: ln}
+	go s.serve()
+	t.Cleanup(func() { s.ln.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&s.conns, 1)
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, "220 fake.smtp ESMTP\r\n")
+
+	scanner := bufio.NewScanner(conn)
+	inData := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inData {
+			if line == "." {
+				inData = false
+				atomic.AddInt32(&s.messages, 1)
+				fmt.Fprint(conn, "250 OK\r\n")
+			}
+			continue
+		}
+		switch upper := strings.ToUpper(line); {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			fmt.Fprint(conn, "250-fake.smtp\r\n250 OK\r\n")
+		case upper == "DATA":
+			fmt.Fprint(conn, "354 Go ahead\r\n")
+			inData = true
+		case upper == "QUIT":
+			fmt.Fprint(conn, "221 Bye\r\n")
+			return
+		case upper == "RSET" && s.resetReached != nil:
+			s.resetReached <- struct{}{}
+			<-s.resetRelease
+			fmt.Fprint(conn, "250 OK\r\n")
+		case upper == "RSET" && atomic.CompareAndSwapInt32(&s.failNextReset, 1, 0):
+			fmt.Fprint(conn, "500 reset refused\r\n")
+		default: // MAIL FROM, RCPT TO, RSET, ...
+			fmt.Fprint(conn, "250 OK\r\n")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeSMTPServer) connections() int32 { return atomic.LoadInt32(&s.conns) }
+
+func (s *fakeSMTPServer) messagesReceived() int32 { return atomic.LoadInt32(&s.messages) }
+
+func (s *fakeSMTPServer) hostPort(t *testing.T) (string, int) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(s.addr())
+	if err != nil {
+		t.Fatalf("SplitHostPort: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("Atoi: %v", err)
+	}
+	return host, port
+}
+
+func TestEmailSendReusesConnection(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+
+	e := New(srv.addr())
+	for i := 0; i < 5; i++ {
+		m := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+		if err := e.Send(m); err != nil {
+			t.Fatalf("Send #%d: %v", i, err)
+		}
+	}
+
+	if got := srv.connections(); got != 1 {
+		t.Fatalf("connections opened across 5 Send calls = %d, want 1", got)
+	}
+}
+
+func TestDialerDialAndSendSendsEveryMessageOverOneConnection(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	host, port := srv.hostPort(t)
+
+	d := NewDialer(host, port, "", "")
+	msgs := make([]*Message, 3)
+	for i := range msgs {
+		msgs[i] = &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	}
+	if err := d.DialAndSend(msgs...); err != nil {
+		t.Fatalf("DialAndSend: %v", err)
+	}
+
+	if got := srv.connections(); got != 1 {
+		t.Fatalf("connections opened = %d, want 1", got)
+	}
+	if got := srv.messagesReceived(); got != int32(len(msgs)) {
+		t.Fatalf("messages received = %d, want %d", got, len(msgs))
+	}
+}
+
+func TestSmtpSendCloserRedialsOnceOnResetFailure(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	host, port := srv.hostPort(t)
+	atomic.StoreInt32(&srv.failNextReset, 1)
+
+	d := NewDialer(host, port, "", "")
+	sc, err := d.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer sc.Close()
+
+	// The RSET this first Send issues is poisoned, so it must redial once
+	// and still deliver the message over the new connection.
+	m1 := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := sc.Send(context.Background(), m1); err != nil {
+		t.Fatalf("Send #1: %v", err)
+	}
+	if got := srv.connections(); got != 2 {
+		t.Fatalf("connections opened after poisoned RSET = %d, want 2", got)
+	}
+
+	// A second Send should succeed on the redialed connection without
+	// triggering another redial.
+	m2 := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := sc.Send(context.Background(), m2); err != nil {
+		t.Fatalf("Send #2: %v", err)
+	}
+	if got := srv.connections(); got != 2 {
+		t.Fatalf("connections opened after second Send = %d, want 2", got)
+	}
+	if got := srv.messagesReceived(); got != 2 {
+		t.Fatalf("messages received = %d, want 2", got)
+	}
+}
+
+// TestSmtpSendCloserContextCancelRacesRedial cancels ctx while Send is
+// blocked waiting for the RSET response, so the per-call watcher goroutine
+// closes conn at the same moment Send handles the now-failed Reset (and
+// possibly redials). Exercises the cancel-during-redial scenario end to end
+// through the public API; TestSmtpSendCloserSwapIsRaceFree below pins down
+// the specific conn/client race under `go test -race`.
+func TestSmtpSendCloserContextCancelRacesRedial(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	srv.resetReached = make(chan struct{})
+	srv.resetRelease = make(chan struct{})
+	t.Cleanup(func() { close(srv.resetRelease) })
+	host, port := srv.hostPort(t)
+
+	d := NewDialer(host, port, "", "")
+	sc, err := d.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer sc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	m := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	go func() {
+		errCh <- sc.Send(ctx, m)
+	}()
+
+	// RSET is now in flight and the server will never reply (it's stuck
+	// waiting on resetRelease), so cancelling here is the only thing that
+	// can unblock Send: the watcher closes conn concurrently with Send's
+	// own handling of the now-failed Reset, which may itself redial.
+	<-srv.resetReached
+	cancel()
+
+	if err := <-errCh; err == nil {
+		t.Fatal("Send with a context cancelled mid-RSET should fail")
+	}
+}
+
+// TestSmtpSendCloserSwapIsRaceFree drives smtpSendCloser's conn/client
+// getters concurrently with redial's swap, the exact interleaving between
+// Send's ctx-cancellation watcher and redial described above. It repeats
+// the race many times over fresh connections so `go test -race` reliably
+// flags a regression if conn/client ever lose their mutex.
+func TestSmtpSendCloserSwapIsRaceFree(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	host, port := srv.hostPort(t)
+	d := NewDialer(host, port, "", "")
+
+	for i := 0; i < 50; i++ {
+		scIface, err := d.Dial()
+		if err != nil {
+			t.Fatalf("Dial #%d: %v", i, err)
+		}
+		sc := scIface.(*smtpSendCloser)
+
+		nextIface, err := d.Dial()
+		if err != nil {
+			t.Fatalf("Dial #%d (next): %v", i, err)
+		}
+		next := nextIface.(*smtpSendCloser)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		start := make(chan struct{})
+		go func() {
+			defer wg.Done()
+			<-start
+			sc.getConn().Close()
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			sc.swap(next.client, next.conn)
+		}()
+		close(start)
+		wg.Wait()
+
+		sc.Close()
+	}
+}
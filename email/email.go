@@ -2,11 +2,15 @@ package email
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"html/template"
+	"mime/quotedprintable"
 	"net"
-	"net/mail"
 	"net/smtp"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/XebulaIO/gommon/random"
@@ -14,30 +18,47 @@ import (
 
 type (
 	Email struct {
-		Auth        smtp.Auth
-		Header      map[string]string
-		Template    *template.Template
-		smtpAddress string
+		Auth           smtp.Auth
+		Header         map[string]string
+		Template       *template.Template
+		Transport      Transport
+		Timeout        time.Duration
+		CommandTimeout time.Duration
+		TLSConfig      *tls.Config
+		LocalName      string
+		smtpAddress    string
+
+		transportOnce sync.Once
+		transportRes  Transport
+		transportErr  error
 	}
 
 	Message struct {
-		ID          string  `json:"id"`
-		From        string  `json:"from"`
-		To          string  `json:"to"`
-		CC          string  `json:"cc"`
-		Subject     string  `json:"subject"`
-		BodyText    string  `json:"body_text"`
-		BodyHTML    string  `json:"body_html"`
-		Inlines     []*File `json:"inlines"`
-		Attachments []*File `json:"attachments"`
+		ID          string   `json:"id"`
+		From        string   `json:"from"`
+		To          string   `json:"to"`
+		CC          string   `json:"cc"`
+		Subject     string   `json:"subject"`
+		BodyText    string   `json:"body_text"`
+		BodyHTML    string   `json:"body_html"`
+		Inlines     []*File  `json:"inlines"`
+		Attachments []*File  `json:"attachments"`
+		Encoding    Encoding `json:"encoding"`
 		buffer      *bytes.Buffer
 		boundary    string
+		extraHeader map[string]string
 	}
 
 	File struct {
-		Name    string
-		Type    string
+		Name string
+		Type string
+		// Content holds the attachment's data base64-encoded. Set Data
+		// instead to pass raw bytes and let writeFile encode them.
 		Content string
+		Data    []byte
+		// ContentID identifies an inline file so BodyHTML can reference it
+		// via "cid:...". Left empty, it's generated when the file is sent.
+		ContentID string
 	}
 )
 
@@ -62,113 +83,210 @@ func (m *Message) writeBoundary() {
 }
 
 func (m *Message) writeText(content string, contentType string) {
+	enc := m.Encoding
+	if enc == "" {
+		enc = QuotedPrintable
+	}
+
 	m.writeBoundary()
 	m.writeHeader("Content-Type", contentType+"; charset=UTF-8")
+	switch enc {
+	case Base64:
+		m.writeHeader("Content-Transfer-Encoding", "base64")
+		m.buffer.WriteString("\r\n")
+		m.buffer.WriteString(base64Wrap([]byte(content)))
+	case Unencoded:
+		m.writeHeader("Content-Transfer-Encoding", "8bit")
+		m.buffer.WriteString("\r\n")
+		m.buffer.WriteString(content)
+	default:
+		m.writeHeader("Content-Transfer-Encoding", "quoted-printable")
+		m.buffer.WriteString("\r\n")
+		qpw := quotedprintable.NewWriter(m.buffer)
+		qpw.Write([]byte(content))
+		qpw.Close()
+	}
+	// Single CRLF separating this part's body from the next boundary line;
+	// the quoted-printable and 8bit branches above must not add their own,
+	// or the decoded body picks up a spurious trailing CRLF (compounding on
+	// every render/parse round trip). The trailing CRLF base64Wrap leaves in
+	// the base64 branch is harmless, as base64 decoding ignores line breaks.
 	m.buffer.WriteString("\r\n")
-	m.buffer.WriteString(content)
-	m.buffer.WriteString("\r\n")
-	m.buffer.WriteString("\r\n")
+}
+
+// fileData returns f's content as raw bytes, decoding f.Content as base64
+// when f.Data isn't set.
+func fileData(f *File) []byte {
+	if f.Data != nil {
+		return f.Data
+	}
+	data, err := base64.StdEncoding.DecodeString(f.Content)
+	if err != nil {
+		return []byte(f.Content)
+	}
+	return data
 }
 
 func (m *Message) writeFile(f *File, disposition string) {
 	m.writeBoundary()
-	m.writeHeader("Content-Type", f.Type+`; name="`+f.Name+`"`)
-	m.writeHeader("Content-Disposition", disposition+`; filename="`+f.Name+`"`)
+	m.writeHeader("Content-Type", encodeContentParam(f.Type, f.Name, "name"))
+	m.writeHeader("Content-Disposition", encodeContentParam(disposition, f.Name, "filename"))
 	m.writeHeader("Content-Transfer-Encoding", "base64")
+	if disposition == "inline" {
+		if f.ContentID == "" {
+			f.ContentID = generateContentID()
+		}
+		m.writeHeader("Content-ID", "<"+f.ContentID+">")
+	}
 	m.buffer.WriteString("\r\n")
-	m.buffer.WriteString(f.Content)
+	m.buffer.WriteString(base64Wrap(fileData(f)))
 	m.buffer.WriteString("\r\n")
+}
+
+func generateContentID() string {
+	return random.String(20) + "@gommon"
+}
+
+// withBoundary runs fn with m.boundary temporarily set to boundary, so the
+// existing writeBoundary/writeText/writeFile helpers write into a nested
+// multipart part.
+func (m *Message) withBoundary(boundary string, fn func()) {
+	prev := m.boundary
+	m.boundary = boundary
+	fn()
+	m.boundary = prev
+}
+
+func (m *Message) writeClosingBoundary(boundary string) {
+	m.buffer.WriteString("--")
+	m.buffer.WriteString(boundary)
+	m.buffer.WriteString("--\r\n")
+}
+
+// writeBody writes BodyText and/or BodyHTML into the current boundary,
+// wrapping both in a multipart/alternative part when both are set.
+func (m *Message) writeBody() {
+	switch {
+	case m.BodyText != "" && m.BodyHTML != "":
+		m.writeAlternative()
+	case m.BodyText != "":
+		m.writeText(m.BodyText, "text/plain")
+	case m.BodyHTML != "":
+		m.writeText(m.BodyHTML, "text/html")
+	default:
+		m.writeBoundary()
+	}
+}
+
+func (m *Message) writeAlternative() {
+	boundary := random.String(16)
+	m.writeBoundary()
+	m.writeHeader("Content-Type", "multipart/alternative; boundary="+boundary)
+	m.buffer.WriteString("\r\n")
+	m.withBoundary(boundary, func() {
+		m.writeText(m.BodyText, "text/plain")
+		m.writeText(m.BodyHTML, "text/html")
+	})
+	m.writeClosingBoundary(boundary)
+}
+
+// writeRelated wraps writeBody and the Inlines in a multipart/related part so
+// mail clients can resolve "cid:..." references from BodyHTML.
+func (m *Message) writeRelated() {
+	boundary := random.String(16)
+	m.writeBoundary()
+	m.writeHeader("Content-Type", "multipart/related; boundary="+boundary)
 	m.buffer.WriteString("\r\n")
+	m.withBoundary(boundary, func() {
+		m.writeBody()
+		for _, f := range m.Inlines {
+			m.writeFile(f, "inline")
+		}
+	})
+	m.writeClosingBoundary(boundary)
 }
 
-func (e *Email) Send(m *Message) (err error) {
-	// Message header
-	m.buffer = bytes.NewBuffer(make([]byte, 256))
-	m.buffer.Reset()
+// render builds the MIME representation of m into m.buffer, merging in any
+// extra headers set via m.extraHeader on top of the message's own.
+func (m *Message) render() {
+	m.buffer = bytes.NewBuffer(make([]byte, 0, 256))
 	m.boundary = random.String(16)
 	m.writeHeader("MIME-Version", "1.0")
 	m.writeHeader("Message-ID", m.ID)
 	m.writeHeader("Date", time.Now().Format(time.RFC1123Z))
-	m.writeHeader("From", m.From)
-	m.writeHeader("To", m.To)
+	m.writeHeader("From", encodeAddressList(m.From))
+	m.writeHeader("To", encodeAddressList(m.To))
 	if m.CC != "" {
-		m.writeHeader("CC", m.CC)
+		m.writeHeader("CC", encodeAddressList(m.CC))
 	}
 	if m.Subject != "" {
-		m.writeHeader("Subject", m.Subject)
+		m.writeHeader("Subject", encodeHeader(m.Subject))
 	}
 	// Extra
-	for k, v := range e.Header {
+	for k, v := range m.extraHeader {
 		m.writeHeader(k, v)
 	}
 	m.writeHeader("Content-Type", "multipart/mixed; boundary="+m.boundary)
 	m.buffer.WriteString("\r\n")
 
-	// Message body
-	if m.BodyText != "" {
-		m.writeText(m.BodyText, "text/plain")
-	} else if m.BodyHTML != "" {
-		m.writeText(m.BodyHTML, "text/html")
+	// Message body, wrapped in multipart/related when there are inlines to
+	// reference via "cid:...", and in multipart/alternative when both a
+	// text and an HTML body are set.
+	if len(m.Inlines) > 0 {
+		m.writeRelated()
 	} else {
-		m.writeBoundary()
+		m.writeBody()
 	}
 
-	// Inlines/attachments
-	for _, f := range m.Inlines {
-		m.writeFile(f, "inline")
-	}
 	for _, f := range m.Attachments {
 		m.writeFile(f, "attachment")
 	}
 	m.buffer.WriteString("--")
 	m.buffer.WriteString(m.boundary)
 	m.buffer.WriteString("--")
+}
 
-	// Dial
-	c, err := smtp.Dial(e.smtpAddress)
+// Send delivers m through e.Transport, falling back to a plain SMTP
+// connection to e.smtpAddress when no Transport is set. The transport is
+// built once and reused across calls, so repeated Send calls share a single
+// SMTP connection instead of dialing anew every time.
+func (e *Email) Send(m *Message) error {
+	t, err := e.transport()
 	if err != nil {
-		return
+		return err
 	}
-	defer c.Quit()
+	m.extraHeader = e.Header
+	return t.Send(context.Background(), m)
+}
 
-	// Check if TLS is required
-	if ok, _ := c.Extension("STARTTLS"); ok {
-		host, _, _ := net.SplitHostPort(e.smtpAddress)
-		config := &tls.Config{ServerName: host}
-		if err = c.StartTLS(config); err != nil {
-			return err
+// transport returns e.Transport, or a Dialer-backed SMTPTransport built from
+// e.smtpAddress on first use. Either way, the result is cached on e so every
+// Send/SendContext call reuses the same Transport instance.
+func (e *Email) transport() (Transport, error) {
+	e.transportOnce.Do(func() {
+		if e.Transport != nil {
+			e.transportRes = e.Transport
+			return
 		}
-	}
-
-	// Authenticate
-	if e.Auth != nil {
-		if err = c.Auth(e.Auth); err != nil {
+		host, portStr, err := net.SplitHostPort(e.smtpAddress)
+		if err != nil {
+			e.transportErr = err
 			return
 		}
-	}
-
-	// Send message
-	from, err := mail.ParseAddress(m.From)
-	if err != nil {
-		return
-	}
-	if err = c.Mail(from.Address); err != nil {
-		return
-	}
-	to, err := mail.ParseAddressList(m.To)
-	if err != nil {
-		return
-	}
-	for _, a := range to {
-		if err = c.Rcpt(a.Address); err != nil {
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			e.transportErr = err
 			return
 		}
-	}
-	wc, err := c.Data()
-	if err != nil {
-		return
-	}
-	defer wc.Close()
-	_, err = m.buffer.WriteTo(wc)
-	return
+		e.transportRes = &SMTPTransport{Dialer: &Dialer{
+			Host:           host,
+			Port:           port,
+			Auth:           e.Auth,
+			TLSConfig:      e.TLSConfig,
+			Timeout:        e.Timeout,
+			CommandTimeout: e.CommandTimeout,
+			LocalName:      e.LocalName,
+		}}
+	})
+	return e.transportRes, e.transportErr
 }
@@ -0,0 +1,154 @@
+package email
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+var headerWordDecoder = new(mime.WordDecoder)
+
+// WriteTo renders m as a MIME document and writes it to w without dialing
+// any server. It lets callers snapshot outgoing mail for tests or re-send a
+// previously composed draft.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	m.render()
+	return m.buffer.WriteTo(w)
+}
+
+// ParseEML reads an RFC 5322 / MIME message from r and reconstructs the
+// Message it describes: quoted-printable/base64 bodies are decoded, nested
+// multipart/* trees are walked, and each part is classified as BodyText,
+// BodyHTML, an inline File (Content-Disposition: inline or referenced by
+// CID), or an attachment File.
+func ParseEML(r io.Reader) (*Message, error) {
+	raw, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Message{
+		ID:      raw.Header.Get("Message-ID"),
+		From:    decodeHeaderWord(raw.Header.Get("From")),
+		To:      decodeHeaderWord(raw.Header.Get("To")),
+		CC:      decodeHeaderWord(raw.Header.Get("Cc")),
+		Subject: decodeHeaderWord(raw.Header.Get("Subject")),
+	}
+
+	mediaType, params, err := mime.ParseMediaType(raw.Header.Get("Content-Type"))
+	if err != nil {
+		data, err := decodeBody(raw.Body, raw.Header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return nil, err
+		}
+		m.BodyText = string(data)
+		return m, nil
+	}
+
+	if err := m.parsePart(mediaType, params, nil, raw.Body); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseEMLFile reads and parses the EML file at path.
+func ParseEMLFile(path string) (*Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseEML(f)
+}
+
+// parsePart walks a (possibly nested) multipart/* body, classifying each
+// leaf part into m's BodyText, BodyHTML, Inlines or Attachments.
+func (m *Message) parsePart(mediaType string, params map[string]string, header textproto.MIMEHeader, body io.Reader) error {
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return m.addPart(mediaType, params, header, body)
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		partType, partParams, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			partType, partParams = "text/plain", map[string]string{}
+		}
+		if err := m.parsePart(partType, partParams, part.Header, part); err != nil {
+			return err
+		}
+	}
+}
+
+// addPart classifies a single leaf part and appends/sets it on m.
+func (m *Message) addPart(mediaType string, params map[string]string, header textproto.MIMEHeader, body io.Reader) error {
+	name := params["name"]
+	disposition, contentID := "", ""
+	if header != nil {
+		if cd := header.Get("Content-Disposition"); cd != "" {
+			if dtype, dparams, err := mime.ParseMediaType(cd); err == nil {
+				disposition = dtype
+				if dparams["filename"] != "" {
+					name = dparams["filename"]
+				}
+			}
+		}
+		contentID = strings.Trim(header.Get("Content-ID"), "<>")
+	}
+
+	var cte string
+	if header != nil {
+		cte = header.Get("Content-Transfer-Encoding")
+	}
+	data, err := decodeBody(body, cte)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case disposition == "attachment":
+		m.Attachments = append(m.Attachments, &File{Name: name, Type: mediaType, Data: data, ContentID: contentID})
+	case disposition == "inline" || contentID != "":
+		m.Inlines = append(m.Inlines, &File{Name: name, Type: mediaType, Data: data, ContentID: contentID})
+	case mediaType == "text/html" && m.BodyHTML == "":
+		m.BodyHTML = string(data)
+	case mediaType == "text/plain" && m.BodyText == "":
+		m.BodyText = string(data)
+	default:
+		m.Attachments = append(m.Attachments, &File{Name: name, Type: mediaType, Data: data})
+	}
+	return nil
+}
+
+func decodeBody(r io.Reader, cte string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(cte)) {
+	case "base64":
+		return io.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(r))
+	default:
+		return io.ReadAll(r)
+	}
+}
+
+func decodeHeaderWord(s string) string {
+	decoded, err := headerWordDecoder.DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
@@ -0,0 +1,103 @@
+package email
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteToParseEMLRoundTrip(t *testing.T) {
+	m := &Message{
+		From:     "sender@example.com",
+		To:       "recipient@example.com",
+		Subject:  "hello",
+		BodyText: "plain body",
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	got, err := ParseEML(&buf)
+	if err != nil {
+		t.Fatalf("ParseEML: %v", err)
+	}
+	if got.BodyText != "plain body" {
+		t.Fatalf("BodyText = %q, want %q", got.BodyText, "plain body")
+	}
+}
+
+func TestWriteToParseEMLRoundTripFullMessage(t *testing.T) {
+	m := &Message{
+		From:     "sender@example.com",
+		To:       "recipient@example.com",
+		Subject:  "hello",
+		BodyText: "plain body",
+		BodyHTML: `<p>html body, see <img src="cid:logo"></p>`,
+		Inlines: []*File{
+			{Name: "logo.png", Type: "image/png", Data: []byte("fake-png-bytes"), ContentID: "logo"},
+		},
+		Attachments: []*File{
+			{Name: "report.pdf", Type: "application/pdf", Data: []byte("fake-pdf-bytes")},
+		},
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	got, err := ParseEML(&buf)
+	if err != nil {
+		t.Fatalf("ParseEML: %v", err)
+	}
+
+	if got.BodyText != m.BodyText {
+		t.Fatalf("BodyText = %q, want %q", got.BodyText, m.BodyText)
+	}
+	if got.BodyHTML != m.BodyHTML {
+		t.Fatalf("BodyHTML = %q, want %q", got.BodyHTML, m.BodyHTML)
+	}
+	if len(got.Inlines) != 1 {
+		t.Fatalf("Inlines = %d parts, want 1", len(got.Inlines))
+	}
+	if got.Inlines[0].ContentID != "logo" {
+		t.Fatalf("Inlines[0].ContentID = %q, want %q", got.Inlines[0].ContentID, "logo")
+	}
+	if string(got.Inlines[0].Data) != "fake-png-bytes" {
+		t.Fatalf("Inlines[0].Data = %q, want %q", got.Inlines[0].Data, "fake-png-bytes")
+	}
+	if len(got.Attachments) != 1 {
+		t.Fatalf("Attachments = %d parts, want 1", len(got.Attachments))
+	}
+	if got.Attachments[0].Name != "report.pdf" {
+		t.Fatalf("Attachments[0].Name = %q, want %q", got.Attachments[0].Name, "report.pdf")
+	}
+	if string(got.Attachments[0].Data) != "fake-pdf-bytes" {
+		t.Fatalf("Attachments[0].Data = %q, want %q", got.Attachments[0].Data, "fake-pdf-bytes")
+	}
+}
+
+func TestWriteToParseEMLRoundTripRepeated(t *testing.T) {
+	m := &Message{
+		From:     "sender@example.com",
+		To:       "recipient@example.com",
+		Subject:  "hello",
+		BodyText: "plain body",
+	}
+
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		if _, err := m.WriteTo(&buf); err != nil {
+			t.Fatalf("round %d: WriteTo: %v", i, err)
+		}
+		parsed, err := ParseEML(&buf)
+		if err != nil {
+			t.Fatalf("round %d: ParseEML: %v", i, err)
+		}
+		if parsed.BodyText != "plain body" {
+			t.Fatalf("round %d: BodyText = %q, want %q", i, parsed.BodyText, "plain body")
+		}
+		m = parsed
+	}
+}
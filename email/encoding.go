@@ -0,0 +1,96 @@
+package email
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+// Encoding selects how a text body part is transfer-encoded.
+type Encoding string
+
+const (
+	// QuotedPrintable encodes bodies with quoted-printable (RFC 2045). It is
+	// the default for text/plain and text/html parts.
+	QuotedPrintable Encoding = "quoted-printable"
+	// Base64 encodes bodies with base64, wrapped at 76 columns.
+	Base64 Encoding = "base64"
+	// Unencoded sends the body as-is with a 8bit Content-Transfer-Encoding.
+	Unencoded Encoding = "8bit"
+)
+
+// isASCII reports whether s contains only 7-bit ASCII characters, in which
+// case it needs no RFC 2047 word encoding.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeHeader applies RFC 2047 word encoding to a header value such as
+// Subject if it contains non-ASCII characters, leaving plain ASCII untouched.
+func encodeHeader(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	return mime.QEncoding.Encode("UTF-8", s)
+}
+
+// encodeAddressList encodes the display name of every address in s (an
+// address or comma-separated address list) per RFC 2047, leaving the
+// addr-spec itself untouched. It builds the address by hand rather than
+// through mail.Address.String(): an encoded-word is all-ASCII, so
+// mail.Address.String() would wrap it in a quoted-string, which RFC 2047 §5
+// forbids and which many clients render as literal "=?UTF-8?...?=" garbage.
+func encodeAddressList(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	addrs, err := mail.ParseAddressList(s)
+	if err != nil {
+		return encodeHeader(s)
+	}
+	encoded := make([]string, len(addrs))
+	for i, a := range addrs {
+		if a.Name == "" {
+			encoded[i] = a.Address
+			continue
+		}
+		encoded[i] = encodeHeader(a.Name) + " <" + a.Address + ">"
+	}
+	return strings.Join(encoded, ", ")
+}
+
+// encodeContentParam formats a Content-Type/Content-Disposition parameter
+// such as name or filename, applying RFC 2231 extended encoding when value
+// contains non-ASCII characters. mime.FormatMediaType returns "" on failure
+// (e.g. an empty header type), in which case we fall back to a plain
+// quoted-string so callers never see a malformed header.
+func encodeContentParam(header, value, param string) string {
+	formatted := mime.FormatMediaType(header, map[string]string{param: value})
+	if formatted == "" {
+		return header + `; ` + param + `="` + value + `"`
+	}
+	return formatted
+}
+
+// base64Wrap base64-encodes data and wraps it at 76 columns, as required by
+// RFC 2045 for the base64 Content-Transfer-Encoding.
+func base64Wrap(data []byte) string {
+	const lineLength = 76
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for i := 0; i < len(encoded); i += lineLength {
+		end := i + lineLength
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		b.WriteString(encoded[i:end])
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
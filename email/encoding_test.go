@@ -0,0 +1,39 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeAddressListDoesNotQuoteEncodedWord(t *testing.T) {
+	got := encodeAddressList(`Jöhn Doe <john@example.com>`)
+	if strings.Contains(got, `"=?`) {
+		t.Fatalf("encoded-word must not be wrapped in a quoted-string, got %q", got)
+	}
+	want := "=?UTF-8?q?J=C3=B6hn_Doe?= <john@example.com>"
+	if got != want {
+		t.Fatalf("encodeAddressList() = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeAddressListASCIIUnchanged(t *testing.T) {
+	const in = "John Doe <john@example.com>"
+	if got := encodeAddressList(in); got != in {
+		t.Fatalf("encodeAddressList(%q) = %q, want unchanged", in, got)
+	}
+}
+
+func TestEncodeContentParamASCII(t *testing.T) {
+	got := encodeContentParam("attachment", "report.pdf", "filename")
+	want := `attachment; filename=report.pdf`
+	if got != want {
+		t.Fatalf("encodeContentParam() = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeContentParamNonASCII(t *testing.T) {
+	got := encodeContentParam("attachment", "résumé.pdf", "filename")
+	if !strings.Contains(got, "filename*=") {
+		t.Fatalf("encodeContentParam() = %q, want RFC 2231 extended filename* parameter", got)
+	}
+}
@@ -0,0 +1,169 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/XebulaIO/gommon/random"
+)
+
+// Transport delivers a rendered Message. Email.Send uses the SMTP transport
+// by default, but swapping in a Transport lets callers route mail through an
+// HTTP provider or a local sink without touching call sites.
+type Transport interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// SMTPTransport delivers messages over SMTP using a Dialer. It dials lazily
+// on the first Send and keeps the connection open, so repeated Send calls
+// reuse it instead of opening a new connection each time.
+type SMTPTransport struct {
+	Dialer *Dialer
+
+	mu sync.Mutex
+	sc SendCloser
+}
+
+func (t *SMTPTransport) Send(ctx context.Context, m *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sc == nil {
+		sc, err := t.Dialer.DialContext(ctx)
+		if err != nil {
+			return err
+		}
+		t.sc = sc
+	}
+	return t.sc.Send(ctx, m)
+}
+
+// MailgunTransport delivers messages via the Mailgun HTTP API by POSTing the
+// rendered MIME document to /v3/{domain}/messages.mime.
+type MailgunTransport struct {
+	Domain        string
+	PrivateAPIKey string
+	BaseURL       string // defaults to https://api.mailgun.net/v3
+	Client        *http.Client
+}
+
+func (t *MailgunTransport) Send(ctx context.Context, m *Message) error {
+	m.render()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return err
+	}
+	if _, err = m.buffer.WriteTo(part); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.mailgun.net/v3"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/"+t.Domain+"/messages.mime", &body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", t.PrivateAPIKey)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("email: mailgun: unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// DevTransport writes the rendered MIME document to Writer, or to a file
+// under Dir when Writer is nil, instead of delivering it. It's meant for
+// local development and tests.
+type DevTransport struct {
+	Writer io.Writer
+	Dir    string
+}
+
+func (t *DevTransport) Send(ctx context.Context, m *Message) error {
+	m.render()
+
+	if t.Writer != nil {
+		_, err := m.buffer.WriteTo(t.Writer)
+		return err
+	}
+
+	dir := t.Dir
+	if dir == "" {
+		dir = "."
+	}
+	// m.ID is caller-supplied; strip it down to a bare filename so a
+	// crafted ID (e.g. "../../etc/passwd") can't escape dir.
+	name := filepath.Base(m.ID)
+	if m.ID == "" {
+		name = random.String(16)
+	}
+	f, err := os.Create(filepath.Join(dir, name+".eml"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = m.buffer.WriteTo(f)
+	return err
+}
+
+// TransportConfig selects and configures a Transport from plain data, e.g.
+// application config files, so the backend can be swapped without code
+// changes.
+type TransportConfig struct {
+	Type string `json:"type"`
+
+	// SMTP
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	SSL      bool   `json:"ssl,omitempty"`
+
+	// Mailgun
+	Domain        string `json:"domain,omitempty"`
+	PrivateAPIKey string `json:"private_api_key,omitempty"`
+
+	// Dev
+	Dir string `json:"dir,omitempty"`
+}
+
+// NewTransport builds the Transport described by cfg.
+func NewTransport(cfg TransportConfig) (Transport, error) {
+	switch cfg.Type {
+	case "", "smtp":
+		dialer := NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password)
+		dialer.SSL = cfg.SSL
+		return &SMTPTransport{Dialer: dialer}, nil
+	case "mailgun":
+		return &MailgunTransport{Domain: cfg.Domain, PrivateAPIKey: cfg.PrivateAPIKey}, nil
+	case "dev":
+		return &DevTransport{Dir: cfg.Dir}, nil
+	default:
+		return nil, fmt.Errorf("email: unknown transport type %q", cfg.Type)
+	}
+}
@@ -0,0 +1,127 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMailgunTransportSendPostsMIMEPart(t *testing.T) {
+	var gotPath, gotUser, gotPass string
+	var gotPart []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotUser, gotPass, _ = r.BasicAuth()
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/form-data" {
+			t.Fatalf("unexpected request Content-Type: %q (%v)", r.Header.Get("Content-Type"), err)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm: %v", err)
+		}
+		fh := r.MultipartForm.File["message"]
+		if len(fh) != 1 {
+			t.Fatalf("message file parts = %d, want 1", len(fh))
+		}
+		f, err := fh[0].Open()
+		if err != nil {
+			t.Fatalf("open message part: %v", err)
+		}
+		defer f.Close()
+		gotPart, err = io.ReadAll(f)
+		if err != nil {
+			t.Fatalf("read message part: %v", err)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	tr := &MailgunTransport{Domain: "mail.example.com", PrivateAPIKey: "key-123", BaseURL: srv.URL}
+	m := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := tr.Send(context.Background(), m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if want := "/mail.example.com/messages.mime"; gotPath != want {
+		t.Fatalf("request path = %q, want %q", gotPath, want)
+	}
+	if gotUser != "api" || gotPass != "key-123" {
+		t.Fatalf("basic auth = %q/%q, want api/key-123", gotUser, gotPass)
+	}
+	if len(gotPart) == 0 {
+		t.Fatalf("message part was empty")
+	}
+}
+
+func TestMailgunTransportSendErrorsOnNon2xx(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	tr := &MailgunTransport{Domain: "mail.example.com", PrivateAPIKey: "key-123", BaseURL: srv.URL}
+	m := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := tr.Send(context.Background(), m); err == nil {
+		t.Fatal("Send with a 400 response should return an error")
+	}
+}
+
+func TestDevTransportSendWritesToWriter(t *testing.T) {
+	var buf bytes.Buffer
+	tr := &DevTransport{Writer: &buf}
+	m := &Message{From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := tr.Send(context.Background(), m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if buf.Len() == 0 {
+		t.Fatal("DevTransport with Writer set wrote nothing")
+	}
+}
+
+func TestDevTransportSendWritesFileUnderDir(t *testing.T) {
+	dir := t.TempDir()
+	tr := &DevTransport{Dir: dir}
+	m := &Message{ID: "msg-1", From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := tr.Send(context.Background(), m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	path := filepath.Join(dir, "msg-1.eml")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+	if info.Size() == 0 {
+		t.Fatalf("%s is empty", path)
+	}
+}
+
+func TestDevTransportSendSanitizesPathTraversalID(t *testing.T) {
+	outside := t.TempDir()
+	dir := filepath.Join(outside, "dir")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	tr := &DevTransport{Dir: dir}
+	m := &Message{ID: "../pwned", From: "a@example.com", To: "b@example.com", Subject: "hi", BodyText: "hello"}
+	if err := tr.Send(context.Background(), m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "pwned.eml")); err == nil {
+		t.Fatal("DevTransport wrote a file outside Dir via a path-traversal ID")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned.eml")); err != nil {
+		t.Fatalf("expected sanitized file under Dir: %v", err)
+	}
+}